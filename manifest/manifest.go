@@ -34,6 +34,11 @@ type Manifest struct {
 	ProtoFiles  []string  `yaml:"protoFiles"`
 	Modules     []*Module `yaml:"modules"`
 
+	// LabelSets declares named, reusable label bundles that modules can
+	// pull in by name via their own `labelSets` field, instead of
+	// repeating the same labels on every module.
+	LabelSets map[string][]LabelPair `yaml:"labelSets"`
+
 	Graph      *ModuleGraph           `yaml:"-"`
 	ProtoDescs []*desc.FileDescriptor `yaml:"-"`
 }
@@ -47,6 +52,24 @@ type Module struct {
 	Code         Code         `yaml:"code"`
 	Inputs       []*Input     `yaml:"inputs"`
 	Output       StreamOutput `yaml:"output"`
+
+	// Labels are free-form key/value pairs used to group and select
+	// modules (see Selector), without hard-coding module names.
+	Labels []LabelPair `yaml:"labels"`
+	// LabelSets references named bundles declared in the top-level
+	// Manifest.LabelSets; their labels are merged into Labels once the
+	// manifest is decoded.
+	LabelSets []string `yaml:"labelSets"`
+}
+
+// LabelPair is a single key/value label attached to a module.
+type LabelPair struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value"`
+}
+
+func (l LabelPair) String() string {
+	return fmt.Sprintf("%s=%s", l.Key, l.Value)
 }
 
 type Input struct {
@@ -145,6 +168,10 @@ func newWithoutLoad(path string) (*Manifest, error) {
 				return nil, fmt.Errorf("module %q: %w", s.Name, err)
 			}
 		}
+
+		if err := s.resolveLabelSets(m.LabelSets); err != nil {
+			return nil, fmt.Errorf("module %q: %w", s.Name, err)
+		}
 	}
 
 	graph, err := NewModuleGraph(m.Modules)
@@ -157,6 +184,19 @@ func newWithoutLoad(path string) (*Manifest, error) {
 	return m, nil
 }
 
+// resolveLabelSets merges the named label sets referenced by the module
+// into its own Labels, in declaration order.
+func (m *Module) resolveLabelSets(labelSets map[string][]LabelPair) error {
+	for _, name := range m.LabelSets {
+		set, found := labelSets[name]
+		if !found {
+			return fmt.Errorf("unknown label set %q", name)
+		}
+		m.Labels = append(m.Labels, set...)
+	}
+	return nil
+}
+
 func (i *Input) parse() error {
 	if i.Map != "" && i.Store == "" && i.Source == "" {
 		i.Name = fmt.Sprintf("map:%s", i.Map)
@@ -307,6 +347,11 @@ func (m *Module) Signature(graph *ModuleGraph) []byte {
 		buf.WriteString(input.Name)
 	}
 
+	for _, label := range sortedLabels(m.Labels) {
+		buf.WriteString(label.Key)
+		buf.WriteString(label.Value)
+	}
+
 	ancestors, _ := graph.AncestorsOf(m.Name)
 	for _, ancestor := range ancestors {
 		sig := ancestor.Signature(graph)
@@ -323,11 +368,35 @@ func (m *Module) String() string {
 	return m.Name
 }
 
+// sortedLabels returns a copy of labels sorted by key then value, so
+// that label order never affects a module's Signature or proto output.
+func sortedLabels(labels []LabelPair) []LabelPair {
+	sorted := make([]LabelPair, len(labels))
+	copy(sorted, labels)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Key != sorted[j].Key {
+			return sorted[i].Key < sorted[j].Key
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+	return sorted
+}
+
+func labelsToProto(labels []LabelPair) []*pbtransform.LabelPair {
+	sorted := sortedLabels(labels)
+	pbLabels := make([]*pbtransform.LabelPair, len(sorted))
+	for i, label := range sorted {
+		pbLabels[i] = &pbtransform.LabelPair{Key: label.Key, Value: label.Value}
+	}
+	return pbLabels
+}
+
 func (m *Module) ToProto(codeIndex uint32) (*pbtransform.Module, error) {
 	pbModule := &pbtransform.Module{
 		Name:           m.Name,
 		CodeIndex:      codeIndex,
 		CodeEntrypoint: m.Code.Entrypoint,
+		Labels:         labelsToProto(m.Labels),
 	}
 
 	if m.Output.Type != "" {
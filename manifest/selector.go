@@ -0,0 +1,163 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Selector is a parsed module label selector, e.g.
+// "team=defi,chain!=eth,tier in (gold,silver)". A module matches a
+// Selector when it satisfies every clause.
+type Selector []selectorClause
+
+type selectorOp string
+
+const (
+	selectorOpEquals    selectorOp = "="
+	selectorOpNotEquals selectorOp = "!="
+	selectorOpIn        selectorOp = "in"
+)
+
+type selectorClause struct {
+	key    string
+	op     selectorOp
+	values []string
+}
+
+var selectorInRegexp = regexp.MustCompile(`^(\S+)\s+in\s+\(([^)]*)\)$`)
+
+// ParseSelector parses a comma-separated list of "key=value",
+// "key!=value" or "key in (v1, v2, ...)" clauses.
+func ParseSelector(raw string) (Selector, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	var selector Selector
+	for _, part := range splitSelectorClauses(raw) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		clause, err := parseSelectorClause(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector clause %q: %w", part, err)
+		}
+		selector = append(selector, clause)
+	}
+
+	return selector, nil
+}
+
+// splitSelectorClauses splits on commas that are not inside an "in (...)"
+// clause.
+func splitSelectorClauses(raw string) []string {
+	var clauses []string
+	depth := 0
+	start := 0
+	for i, r := range raw {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, raw[start:])
+}
+
+func parseSelectorClause(part string) (selectorClause, error) {
+	if m := selectorInRegexp.FindStringSubmatch(part); m != nil {
+		values := strings.Split(m[2], ",")
+		for i, v := range values {
+			values[i] = strings.TrimSpace(v)
+		}
+		return selectorClause{key: m[1], op: selectorOpIn, values: values}, nil
+	}
+
+	if idx := strings.Index(part, "!="); idx >= 0 {
+		return selectorClause{
+			key:    strings.TrimSpace(part[:idx]),
+			op:     selectorOpNotEquals,
+			values: []string{strings.TrimSpace(part[idx+2:])},
+		}, nil
+	}
+
+	if idx := strings.Index(part, "="); idx >= 0 {
+		return selectorClause{
+			key:    strings.TrimSpace(part[:idx]),
+			op:     selectorOpEquals,
+			values: []string{strings.TrimSpace(part[idx+1:])},
+		}, nil
+	}
+
+	return selectorClause{}, fmt.Errorf("expected 'key=value', 'key!=value' or 'key in (v1, v2)'")
+}
+
+// Matches reports whether labels satisfies every clause of the selector.
+func (s Selector) Matches(labels []LabelPair) bool {
+	valuesByKey := make(map[string][]string, len(labels))
+	for _, label := range labels {
+		valuesByKey[label.Key] = append(valuesByKey[label.Key], label.Value)
+	}
+
+	for _, clause := range s {
+		if !clause.matches(valuesByKey[clause.key]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c selectorClause) matches(values []string) bool {
+	switch c.op {
+	case selectorOpEquals:
+		return containsString(values, c.values[0])
+	case selectorOpNotEquals:
+		return !containsString(values, c.values[0])
+	case selectorOpIn:
+		for _, v := range c.values {
+			if containsString(values, v) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectByLabels returns every module in the graph whose labels satisfy
+// selector, in topological order, so downstream tooling can address
+// subsets of modules without hard-coding names.
+func (g *ModuleGraph) SelectByLabels(selector Selector) ([]*Module, error) {
+	modules, err := g.TopologicalSort()
+	if err != nil {
+		return nil, fmt.Errorf("sorting modules: %w", err)
+	}
+
+	var selected []*Module
+	for _, module := range modules {
+		if selector.Matches(module.Labels) {
+			selected = append(selected, module)
+		}
+	}
+	return selected, nil
+}
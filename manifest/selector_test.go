@@ -0,0 +1,146 @@
+package manifest
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Selector
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			raw:  "",
+			want: nil,
+		},
+		{
+			name: "single equals",
+			raw:  "team=defi",
+			want: Selector{{key: "team", op: selectorOpEquals, values: []string{"defi"}}},
+		},
+		{
+			name: "not equals",
+			raw:  "chain!=eth",
+			want: Selector{{key: "chain", op: selectorOpNotEquals, values: []string{"eth"}}},
+		},
+		{
+			name: "in clause",
+			raw:  "tier in (gold, silver)",
+			want: Selector{{key: "tier", op: selectorOpIn, values: []string{"gold", "silver"}}},
+		},
+		{
+			name: "multiple clauses including an in clause with embedded commas",
+			raw:  "team=defi,tier in (gold,silver,bronze),chain!=eth",
+			want: Selector{
+				{key: "team", op: selectorOpEquals, values: []string{"defi"}},
+				{key: "tier", op: selectorOpIn, values: []string{"gold", "silver", "bronze"}},
+				{key: "chain", op: selectorOpNotEquals, values: []string{"eth"}},
+			},
+		},
+		{
+			name:    "malformed clause",
+			raw:     "team",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSelector(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d clauses, want %d (%+v vs %+v)", len(got), len(tt.want), got, tt.want)
+			}
+			for i := range got {
+				if got[i].key != tt.want[i].key || got[i].op != tt.want[i].op {
+					t.Errorf("clause %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+				if len(got[i].values) != len(tt.want[i].values) {
+					t.Errorf("clause %d: got values %v, want %v", i, got[i].values, tt.want[i].values)
+					continue
+				}
+				for j := range got[i].values {
+					if got[i].values[j] != tt.want[i].values[j] {
+						t.Errorf("clause %d value %d: got %q, want %q", i, j, got[i].values[j], tt.want[i].values[j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := []LabelPair{
+		{Key: "team", Value: "defi"},
+		{Key: "chain", Value: "eth"},
+		{Key: "tier", Value: "gold"},
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{name: "matching equals", raw: "team=defi", want: true},
+		{name: "non-matching equals", raw: "team=nft", want: false},
+		{name: "matching not-equals", raw: "chain!=bsc", want: true},
+		{name: "non-matching not-equals", raw: "chain!=eth", want: false},
+		{name: "matching in", raw: "tier in (silver, gold)", want: true},
+		{name: "non-matching in", raw: "tier in (silver, bronze)", want: false},
+		{name: "all clauses match", raw: "team=defi,chain=eth,tier in (gold)", want: true},
+		{name: "one clause fails", raw: "team=defi,chain=bsc", want: false},
+		{name: "key absent from labels", raw: "missing=value", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseSelector(tt.raw)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := selector.Matches(labels); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSelectorClauses(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []string
+	}{
+		{name: "no clauses to split", raw: "team=defi", want: []string{"team=defi"}},
+		{name: "plain commas", raw: "a=1,b=2", want: []string{"a=1", "b=2"}},
+		{
+			name: "commas inside parens are not split points",
+			raw:  "tier in (gold,silver),team=defi",
+			want: []string{"tier in (gold,silver)", "team=defi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSelectorClauses(tt.raw)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("clause %d: got %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
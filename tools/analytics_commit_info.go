@@ -0,0 +1,374 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/substreams/manifest"
+	pbanalytics "github.com/streamingfast/substreams/pb/sf/substreams/analytics/v1"
+	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
+	store2 "github.com/streamingfast/substreams/storage/store"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var analyticsCommitInfoCmd = &cobra.Command{
+	Use:   "commit-info <manifest> <store>",
+	Short: "Computes a reproducible, signable CommitInfo for every store module at a given block",
+	Args:  cobra.ExactArgs(2),
+	RunE:  CommitInfoE,
+}
+
+func init() {
+	analyticsCommitInfoCmd.Flags().Uint64("block", 0, "Block height to compute the CommitInfo at (required)")
+	analyticsCommitInfoCmd.Flags().String("verify", "", "Path to a previously-emitted CommitInfo; if set, recompute and report any store whose CommitID diverges instead of printing a new one")
+	analyticsCmd.AddCommand(analyticsCommitInfoCmd)
+}
+
+func CommitInfoE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	manifestPath := args[0]
+	storePath := args[1]
+
+	atBlock, err := cmd.Flags().GetUint64("block")
+	if err != nil {
+		return fmt.Errorf("reading block flag: %w", err)
+	}
+	if atBlock == 0 {
+		return fmt.Errorf("--block is required")
+	}
+
+	verifyPath, err := cmd.Flags().GetString("verify")
+	if err != nil {
+		return fmt.Errorf("reading verify flag: %w", err)
+	}
+
+	commitInfo, err := BuildCommitInfo(ctx, manifestPath, storePath, atBlock)
+	if err != nil {
+		return fmt.Errorf("building commit info: %w", err)
+	}
+
+	if verifyPath != "" {
+		return verifyCommitInfo(commitInfo, verifyPath, cmd.OutOrStdout())
+	}
+
+	data, err := (protojson.MarshalOptions{Multiline: true, Indent: "  "}).Marshal(commitInfo)
+	if err != nil {
+		return fmt.Errorf("marshaling commit info: %w", err)
+	}
+
+	_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return nil
+}
+
+// BuildCommitInfo computes a CommitInfo for every store module in the
+// package, at or before block `atBlock`. For each module it loads the
+// snapshot, deterministically iterates its KVs via `stateStore.Iter`,
+// and hashes them into a per-store Merkle root; the overall MerkleRoot
+// is computed over the sorted StoreInfo entries.
+func BuildCommitInfo(ctx context.Context, manifestPath, storePath string, atBlock uint64) (*pbanalytics.CommitInfo, error) {
+	baseDStore, err := dstore.NewStore(storePath, "", "", false)
+	if err != nil {
+		return nil, fmt.Errorf("creating base store: %w", err)
+	}
+
+	manifestReader := manifest.NewReader(manifestPath)
+	pkg, err := manifestReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read manifest %q: %w", manifestPath, err)
+	}
+
+	graph, err := manifest.NewModuleGraph(pkg.Modules.Modules)
+	if err != nil {
+		return nil, fmt.Errorf("creating module graph: %w", err)
+	}
+
+	hashes := manifest.NewModuleHashes()
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(pkg.Modules.Modules))
+
+	storeInfoStream := make(chan *pbanalytics.StoreInfo)
+	go func() {
+		wg.Wait()
+		close(storeInfoStream)
+	}()
+
+	// firstErr fails the whole run if any module's store can't be
+	// attested to: a CommitInfo is meant to be signed, so a store we
+	// failed to fully iterate must never be emitted as a normal,
+	// non-Missing entry with a fabricated hash.
+	var mu sync.Mutex
+	var firstErr error
+	recordErr := func(moduleName string, err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = fmt.Errorf("module %q: %w", moduleName, err)
+		}
+		mu.Unlock()
+	}
+
+	for _, module := range pkg.Modules.Modules {
+		go func(module *pbsubstreams.Module) {
+			defer wg.Done()
+			if module.GetKindStore() == nil {
+				zlog.Debug("skipping non-store module", zap.String("module", module.Name))
+				return
+			}
+
+			conf, err := store2.NewConfig(
+				module.Name,
+				module.InitialBlock,
+				hex.EncodeToString(hashes.HashModule(pkg.Modules, module, graph)),
+				module.GetKind().(*pbsubstreams.Module_KindStore_).KindStore.UpdatePolicy,
+				module.GetKind().(*pbsubstreams.Module_KindStore_).KindStore.ValueType,
+				baseDStore,
+			)
+			if err != nil {
+				recordErr(module.Name, fmt.Errorf("creating store config: %w", err))
+				return
+			}
+
+			stateStore, fileInfo, err := getStoreAtBlock(ctx, conf, atBlock)
+			if err != nil {
+				if errors.Is(err, EmptyStoreError) {
+					zlog.Debug("no snapshot at or before block, recording as missing", zap.String("module", module.Name), zap.Uint64("block", atBlock))
+					storeInfoStream <- &pbanalytics.StoreInfo{
+						Name:       conf.Name(),
+						ModuleHash: conf.ModuleHash(),
+						Missing:    true,
+					}
+					return
+				}
+				recordErr(module.Name, fmt.Errorf("loading store: %w", err))
+				return
+			}
+
+			fileSize, err := conf.FileSize(ctx, fileInfo)
+			if err != nil {
+				recordErr(module.Name, fmt.Errorf("getting file size: %w", err))
+				return
+			}
+
+			storeInfo, err := buildStoreInfo(conf, fileInfo, fileSize, stateStore)
+			if err != nil {
+				recordErr(module.Name, err)
+				return
+			}
+
+			storeInfoStream <- storeInfo
+		}(module)
+	}
+
+	storeInfos := make([]*pbanalytics.StoreInfo, 0, len(pkg.Modules.Modules))
+	for info := range storeInfoStream {
+		storeInfos = append(storeInfos, info)
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(storeInfos, func(i, j int) bool {
+		return storeInfos[i].Name < storeInfos[j].Name
+	})
+
+	rootLeaves := make([][]byte, len(storeInfos))
+	for i, info := range storeInfos {
+		if info.Missing {
+			// A distinct, name-dependent sentinel so a missing module
+			// changes the overall root instead of silently matching
+			// some other store's hash.
+			rootLeaves[i] = []byte("missing:" + info.Name)
+			continue
+		}
+		rootLeaves[i] = info.CommitId.Hash
+	}
+
+	return &pbanalytics.CommitInfo{
+		Version:    atBlock,
+		StoreInfos: storeInfos,
+		MerkleRoot: merkleRoot(rootLeaves),
+	}, nil
+}
+
+func buildStoreInfo(conf *store2.Config, fileInfo *store2.FileInfo, fileSize uint64, stateStore store2.Store) (*pbanalytics.StoreInfo, error) {
+	storeInfo := &pbanalytics.StoreInfo{
+		Name:       conf.Name(),
+		ModuleHash: conf.ModuleHash(),
+		CommitId: &pbanalytics.CommitID{
+			FileName: fileInfo.Filename,
+			FileSize: fileSize,
+			BlockRange: &pbanalytics.BlockRange{
+				StartBlock: fileInfo.StartBlock,
+				EndBlock:   fileInfo.EndBlock,
+			},
+		},
+	}
+
+	var leaves [][]byte
+	err := stateStore.Iter(func(key string, value []byte) error {
+		leaves = append(leaves, encodeKVLeaf(key, value))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("iterating store: %w", err)
+	}
+
+	// Sort the encoded leaves so the root does not depend on the order
+	// in which Iter yields keys.
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i], leaves[j]) < 0
+	})
+	storeInfo.CommitId.Hash = merkleRoot(leaves)
+	return storeInfo, nil
+}
+
+// getStoreAtBlock loads the latest full snapshot at or before atBlock,
+// unlike getStore which always loads the latest snapshot available.
+func getStoreAtBlock(ctx context.Context, conf *store2.Config, atBlock uint64) (store2.Store, *store2.FileInfo, error) {
+	files, err := conf.ListSnapshotFiles(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing snapshot files: %w", err)
+	}
+
+	var latestFile *store2.FileInfo
+	for _, file := range files {
+		if file.Partial || file.EndBlock > atBlock {
+			continue
+		}
+		if latestFile == nil || file.EndBlock > latestFile.EndBlock {
+			latestFile = file
+		}
+	}
+	if latestFile == nil {
+		return nil, nil, EmptyStoreError
+	}
+
+	s := conf.NewFullKV(zlog)
+	if err := s.Load(ctx, latestFile.EndBlock); err != nil {
+		return nil, nil, fmt.Errorf("loading store: %w", err)
+	}
+
+	return s, latestFile, nil
+}
+
+func verifyCommitInfo(recomputed *pbanalytics.CommitInfo, path string, out io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading commit info %q: %w", path, err)
+	}
+
+	previous := &pbanalytics.CommitInfo{}
+	if err := protojson.Unmarshal(data, previous); err != nil {
+		return fmt.Errorf("decoding commit info %q: %w", path, err)
+	}
+
+	previousByName := make(map[string]*pbanalytics.StoreInfo, len(previous.StoreInfos))
+	for _, info := range previous.StoreInfos {
+		previousByName[info.Name] = info
+	}
+	recomputedByName := make(map[string]*pbanalytics.StoreInfo, len(recomputed.StoreInfos))
+	for _, info := range recomputed.StoreInfos {
+		recomputedByName[info.Name] = info
+	}
+
+	var diverged []string
+	for _, info := range recomputed.StoreInfos {
+		prev, found := previousByName[info.Name]
+		if !found {
+			diverged = append(diverged, fmt.Sprintf("%s: not present in %q", info.Name, path))
+			continue
+		}
+		if prev.Missing != info.Missing {
+			diverged = append(diverged, fmt.Sprintf("%s: missing status diverges (recorded missing=%v, recomputed missing=%v)", info.Name, prev.Missing, info.Missing))
+			continue
+		}
+		if !info.Missing && !bytes.Equal(prev.CommitId.GetHash(), info.CommitId.GetHash()) {
+			diverged = append(diverged, fmt.Sprintf("%s: commit id %x diverges from recorded %x", info.Name, info.CommitId.GetHash(), prev.CommitId.GetHash()))
+		}
+	}
+	for _, info := range previous.StoreInfos {
+		if _, found := recomputedByName[info.Name]; !found {
+			diverged = append(diverged, fmt.Sprintf("%s: present in %q but missing from recomputed commit info", info.Name, path))
+		}
+	}
+
+	if len(diverged) > 0 {
+		return fmt.Errorf("commit info diverges from %q:\n%s", path, strings.Join(diverged, "\n"))
+	}
+
+	_, _ = fmt.Fprintf(out, "commit info matches recorded attestation in %q\n", path)
+	return nil
+}
+
+// encodeKVLeaf renders a key/value pair into the leaf encoding hashed by
+// merkleRoot: len(key)|key|len(value)|value, all lengths as big-endian
+// uint64, so leaves are unambiguous regardless of key/value content.
+func encodeKVLeaf(key string, value []byte) []byte {
+	buf := make([]byte, 8, 8+len(key)+8+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(len(key)))
+	buf = append(buf, key...)
+
+	var valueLen [8]byte
+	binary.BigEndian.PutUint64(valueLen[:], uint64(len(value)))
+	buf = append(buf, valueLen[:]...)
+	buf = append(buf, value...)
+
+	return buf
+}
+
+// merkleRoot computes the RFC 6962 Merkle Tree Hash over leaves, in the
+// order given. Domain separation between leaf and internal nodes (the
+// 0x00/0x01 prefixes in rfc6962LeafHash/rfc6962NodeHash) is what makes
+// the tree second-preimage resistant.
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		// RFC 6962 defines the empty tree's hash as the plain SHA-256 of
+		// the empty string, with no leaf-domain prefix.
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return rfc6962LeafHash(leaves[0])
+	default:
+		split := largestPowerOfTwoLessThan(len(leaves))
+		return rfc6962NodeHash(merkleRoot(leaves[:split]), merkleRoot(leaves[split:]))
+	}
+}
+
+func rfc6962LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func rfc6962NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+func largestPowerOfTwoLessThan(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
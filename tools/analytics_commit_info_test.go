@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestEncodeKVLeaf(t *testing.T) {
+	got := encodeKVLeaf("ab", []byte("xyz"))
+
+	want := []byte{0, 0, 0, 0, 0, 0, 0, 2} // len("ab")
+	want = append(want, 'a', 'b')
+	want = append(want, 0, 0, 0, 0, 0, 0, 0, 3) // len("xyz")
+	want = append(want, 'x', 'y', 'z')
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	leaf := func(data []byte) []byte { return rfc6962LeafHash(data) }
+	node := func(left, right []byte) []byte { return rfc6962NodeHash(left, right) }
+
+	a, b, c := []byte("a"), []byte("b"), []byte("c")
+
+	tests := []struct {
+		name   string
+		leaves [][]byte
+		want   []byte
+	}{
+		{
+			name:   "empty tree is the plain sha256 of nothing, not a domain-separated leaf hash",
+			leaves: nil,
+			want:   func() []byte { sum := sha256.Sum256(nil); return sum[:] }(),
+		},
+		{
+			name:   "single leaf",
+			leaves: [][]byte{a},
+			want:   leaf(a),
+		},
+		{
+			name:   "two leaves",
+			leaves: [][]byte{a, b},
+			want:   node(leaf(a), leaf(b)),
+		},
+		{
+			name:   "odd leaf count splits at the largest power of two below the count",
+			leaves: [][]byte{a, b, c},
+			want:   node(node(leaf(a), leaf(b)), leaf(c)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := merkleRoot(tt.leaves)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLargestPowerOfTwoLessThan(t *testing.T) {
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{n: 2, want: 1},
+		{n: 3, want: 2},
+		{n: 4, want: 2},
+		{n: 5, want: 4},
+		{n: 8, want: 4},
+		{n: 9, want: 8},
+	}
+
+	for _, tt := range tests {
+		if got := largestPowerOfTwoLessThan(tt.n); got != tt.want {
+			t.Errorf("largestPowerOfTwoLessThan(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
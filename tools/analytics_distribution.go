@@ -0,0 +1,371 @@
+package tools
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	pbanalytics "github.com/streamingfast/substreams/pb/sf/substreams/analytics/v1"
+)
+
+// defaultDigestCompression is the t-digest's compression parameter:
+// higher values allow more, smaller centroids, trading memory for
+// percentile accuracy. The digest buffers up to 20x this many
+// centroids between merges.
+const defaultDigestCompression = 100
+
+// histogramBucketBounds are the fixed size buckets reported in a
+// Distribution's histogram: powers of two from 1B to 1MiB. Anything
+// larger falls into the overflow bucket.
+var histogramBucketBounds = func() []uint64 {
+	bounds := make([]uint64, 0, 21)
+	for bound := uint64(1); bound <= 1<<20; bound <<= 1 {
+		bounds = append(bounds, bound)
+	}
+	return bounds
+}()
+
+// Distribution is a size-distribution summary over the keys or values
+// of a store, built incrementally while iterating it.
+type Distribution struct {
+	MinSize uint64 `json:"min_size_bytes"`
+
+	P50  float64 `json:"p50_size_bytes"`
+	P90  float64 `json:"p90_size_bytes"`
+	P95  float64 `json:"p95_size_bytes"`
+	P99  float64 `json:"p99_size_bytes"`
+	P999 float64 `json:"p99_9_size_bytes"`
+
+	Histogram []HistogramBucket `json:"histogram"`
+	TopK      []TopKEntry       `json:"top_k"`
+}
+
+func (d *Distribution) toProto() *pbanalytics.Distribution {
+	if d == nil {
+		return nil
+	}
+
+	pb := &pbanalytics.Distribution{
+		MinSizeBytes:  d.MinSize,
+		P50SizeBytes:  d.P50,
+		P90SizeBytes:  d.P90,
+		P95SizeBytes:  d.P95,
+		P99SizeBytes:  d.P99,
+		P999SizeBytes: d.P999,
+	}
+
+	pb.Histogram = make([]*pbanalytics.HistogramBucket, len(d.Histogram))
+	for i, bucket := range d.Histogram {
+		pb.Histogram[i] = &pbanalytics.HistogramBucket{
+			UpperBoundBytes: bucket.UpperBoundBytes,
+			Count:           bucket.Count,
+		}
+	}
+
+	pb.TopK = make([]*pbanalytics.TopKEntry, len(d.TopK))
+	for i, entry := range d.TopK {
+		pb.TopK[i] = &pbanalytics.TopKEntry{Key: entry.Key, SizeBytes: entry.SizeBytes}
+	}
+
+	return pb
+}
+
+// HistogramBucket counts how many keys or values fall at or under
+// UpperBoundBytes. A zero UpperBoundBytes (omitted in JSON) marks the
+// overflow bucket, for sizes above the largest fixed bound.
+type HistogramBucket struct {
+	UpperBoundBytes uint64 `json:"upper_bound_bytes,omitempty"`
+	Count           uint64 `json:"count"`
+}
+
+// TopKEntry is one of the K largest keys or values seen, in descending
+// size order.
+type TopKEntry struct {
+	Key       string `json:"key"`
+	SizeBytes uint64 `json:"size_bytes"`
+}
+
+// sizeAggregator folds a stream of (key, size) pairs into a
+// Distribution without ever holding every size in memory (unless
+// exact is set, trading that guarantee for exact percentiles).
+type sizeAggregator struct {
+	exact bool
+
+	running   runningStats
+	digest    *tdigest
+	histogram sizeHistogram
+	top       *topKTracker
+
+	min    uint64
+	minSet bool
+
+	exactSizes []uint64
+}
+
+func newSizeAggregator(topK int, exact bool) *sizeAggregator {
+	return &sizeAggregator{
+		exact:  exact,
+		digest: newTDigest(defaultDigestCompression),
+		top:    newTopKTracker(topK),
+	}
+}
+
+func (a *sizeAggregator) observe(key string, size uint64) {
+	if !a.minSet || size < a.min {
+		a.min = size
+		a.minSet = true
+	}
+
+	a.running.observe(float64(size))
+	a.digest.Add(float64(size))
+	a.histogram.observe(size)
+	a.top.observe(key, size)
+
+	if a.exact {
+		a.exactSizes = append(a.exactSizes, size)
+	}
+}
+
+func (a *sizeAggregator) distribution() *Distribution {
+	quantile := a.digest.Quantile
+	if a.exact {
+		quantile = exactQuantileFunc(a.exactSizes)
+	}
+
+	return &Distribution{
+		MinSize:   a.min,
+		P50:       quantile(0.50),
+		P90:       quantile(0.90),
+		P95:       quantile(0.95),
+		P99:       quantile(0.99),
+		P999:      quantile(0.999),
+		Histogram: a.histogram.toSlice(),
+		TopK:      a.top.entries(),
+	}
+}
+
+// runningStats computes mean and variance online, via Welford's
+// algorithm, in O(1) space regardless of how many values are observed.
+type runningStats struct {
+	count uint64
+	mean  float64
+	m2    float64
+}
+
+func (r *runningStats) observe(x float64) {
+	r.count++
+	delta := x - r.mean
+	r.mean += delta / float64(r.count)
+	r.m2 += delta * (x - r.mean)
+}
+
+func (r *runningStats) stdDev() float64 {
+	if r.count == 0 {
+		return 0
+	}
+	return math.Sqrt(r.m2 / float64(r.count))
+}
+
+// exactQuantileFunc sorts sizes once and returns a function computing
+// exact percentiles from it via linear interpolation between ranks.
+func exactQuantileFunc(sizes []uint64) func(q float64) float64 {
+	sorted := make([]uint64, len(sizes))
+	copy(sorted, sizes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return func(q float64) float64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+
+		rank := q * float64(len(sorted)-1)
+		lo := int(math.Floor(rank))
+		hi := int(math.Ceil(rank))
+		if hi >= len(sorted) {
+			hi = len(sorted) - 1
+		}
+		frac := rank - float64(lo)
+
+		return float64(sorted[lo])*(1-frac) + float64(sorted[hi])*frac
+	}
+}
+
+// sizeHistogram buckets sizes into power-of-two ranges, so its memory
+// footprint stays fixed (len(histogramBucketBounds)+1 counters)
+// regardless of how many sizes are observed.
+type sizeHistogram struct {
+	buckets []uint64
+}
+
+func (h *sizeHistogram) observe(size uint64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(histogramBucketBounds)+1)
+	}
+
+	for i, bound := range histogramBucketBounds {
+		if size <= bound {
+			h.buckets[i]++
+			return
+		}
+	}
+	h.buckets[len(h.buckets)-1]++
+}
+
+func (h *sizeHistogram) toSlice() []HistogramBucket {
+	out := make([]HistogramBucket, 0, len(h.buckets))
+	for i, count := range h.buckets {
+		if count == 0 {
+			continue
+		}
+
+		bucket := HistogramBucket{Count: count}
+		if i < len(histogramBucketBounds) {
+			bucket.UpperBoundBytes = histogramBucketBounds[i]
+		}
+		out = append(out, bucket)
+	}
+	return out
+}
+
+// topKTracker keeps the K largest (key, size) entries seen, using a
+// bounded min-heap so it never grows past K regardless of how many
+// entries are observed.
+type topKTracker struct {
+	k    int
+	heap topKHeap
+}
+
+func newTopKTracker(k int) *topKTracker {
+	if k <= 0 {
+		k = 1
+	}
+	return &topKTracker{k: k}
+}
+
+func (t *topKTracker) observe(key string, size uint64) {
+	if len(t.heap) < t.k {
+		heap.Push(&t.heap, topKHeapEntry{key: key, size: size})
+		return
+	}
+	if len(t.heap) > 0 && size > t.heap[0].size {
+		heap.Pop(&t.heap)
+		heap.Push(&t.heap, topKHeapEntry{key: key, size: size})
+	}
+}
+
+func (t *topKTracker) entries() []TopKEntry {
+	sorted := make(topKHeap, len(t.heap))
+	copy(sorted, t.heap)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].size > sorted[j].size })
+
+	out := make([]TopKEntry, len(sorted))
+	for i, entry := range sorted {
+		out[i] = TopKEntry{Key: entry.key, SizeBytes: entry.size}
+	}
+	return out
+}
+
+type topKHeapEntry struct {
+	key  string
+	size uint64
+}
+
+// topKHeap is a min-heap by size, so the smallest of the current top-K
+// is always at the root and can be evicted in O(log k).
+type topKHeap []topKHeapEntry
+
+func (h topKHeap) Len() int            { return len(h) }
+func (h topKHeap) Less(i, j int) bool  { return h[i].size < h[j].size }
+func (h topKHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topKHeap) Push(x interface{}) { *h = append(*h, x.(topKHeapEntry)) }
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
+
+// tdigest is a simplified implementation of Ted Dunning's t-digest: an
+// approximate quantile sketch that merges nearby observations into
+// weighted centroids. Add buffers raw observations and merges them once
+// more than 20*compression centroids are held, giving O(compression)
+// state instead of O(n).
+type tdigest struct {
+	compression float64
+	centroids   []tdigestCentroid
+	count       float64
+}
+
+type tdigestCentroid struct {
+	mean   float64
+	weight float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{compression: compression}
+}
+
+func (t *tdigest) Add(value float64) {
+	t.centroids = append(t.centroids, tdigestCentroid{mean: value, weight: 1})
+	t.count++
+
+	if float64(len(t.centroids)) > t.compression*20 {
+		t.compress()
+	}
+}
+
+func (t *tdigest) compress() {
+	if len(t.centroids) == 0 {
+		return
+	}
+
+	sort.Slice(t.centroids, func(i, j int) bool { return t.centroids[i].mean < t.centroids[j].mean })
+
+	merged := make([]tdigestCentroid, 0, len(t.centroids))
+	cumulative := 0.0
+	cur := t.centroids[0]
+
+	for _, c := range t.centroids[1:] {
+		q := (cumulative + cur.weight/2) / t.count
+		maxWeight := 4 * t.count * q * (1 - q) / t.compression
+
+		if cur.weight+c.weight <= maxWeight {
+			newWeight := cur.weight + c.weight
+			cur.mean = (cur.mean*cur.weight + c.mean*c.weight) / newWeight
+			cur.weight = newWeight
+			continue
+		}
+
+		cumulative += cur.weight
+		merged = append(merged, cur)
+		cur = c
+	}
+	merged = append(merged, cur)
+
+	t.centroids = merged
+}
+
+// Quantile returns an approximate value at quantile q (0..1).
+func (t *tdigest) Quantile(q float64) float64 {
+	if len(t.centroids) == 0 {
+		return 0
+	}
+
+	t.compress()
+	if len(t.centroids) == 1 {
+		return t.centroids[0].mean
+	}
+
+	target := q * t.count
+	cumulative := 0.0
+	for i, c := range t.centroids {
+		next := cumulative + c.weight
+		if target <= next || i == len(t.centroids)-1 {
+			return c.mean
+		}
+		cumulative = next
+	}
+
+	return t.centroids[len(t.centroids)-1].mean
+}
@@ -0,0 +1,138 @@
+package tools
+
+import "testing"
+
+func TestSizeHistogram(t *testing.T) {
+	var h sizeHistogram
+	for _, size := range []uint64{1, 1, 2, 5, 1024, 1 << 20, (1 << 20) + 1} {
+		h.observe(size)
+	}
+
+	buckets := h.toSlice()
+
+	var overflow uint64
+	found := map[uint64]uint64{}
+	for _, b := range buckets {
+		if b.UpperBoundBytes == 0 {
+			overflow = b.Count
+			continue
+		}
+		found[b.UpperBoundBytes] = b.Count
+	}
+
+	if overflow != 1 {
+		t.Errorf("overflow bucket count = %d, want 1 (for the one value above 1MiB)", overflow)
+	}
+	if found[1] != 2 {
+		t.Errorf("bucket <=1 count = %d, want 2", found[1])
+	}
+	if found[2] != 1 {
+		t.Errorf("bucket <=2 count = %d, want 1", found[2])
+	}
+	if found[8] != 1 {
+		t.Errorf("bucket <=8 count = %d, want 1 (for the value 5)", found[8])
+	}
+	if found[1<<20] != 1 {
+		t.Errorf("bucket <=1MiB count = %d, want 1 (for the value 1MiB itself)", found[1<<20])
+	}
+}
+
+func TestTopKTracker(t *testing.T) {
+	tests := []struct {
+		name string
+		k    int
+	}{
+		{name: "zero clamps to 1", k: 0},
+		{name: "negative clamps to 1", k: -5},
+		{name: "normal k", k: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			top := newTopKTracker(tt.k)
+			top.observe("a", 10)
+			top.observe("b", 30)
+			top.observe("c", 20)
+
+			entries := top.entries()
+
+			wantK := tt.k
+			if wantK <= 0 {
+				wantK = 1
+			}
+			if len(entries) != wantK {
+				t.Fatalf("got %d entries, want %d", len(entries), wantK)
+			}
+
+			if entries[0].Key != "b" || entries[0].SizeBytes != 30 {
+				t.Errorf("largest entry = %+v, want key=b size=30", entries[0])
+			}
+			for i := 1; i < len(entries); i++ {
+				if entries[i].SizeBytes > entries[i-1].SizeBytes {
+					t.Errorf("entries not in descending order: %+v", entries)
+				}
+			}
+		})
+	}
+}
+
+func TestRunningStats(t *testing.T) {
+	var r runningStats
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		r.observe(x)
+	}
+
+	if r.mean != 5 {
+		t.Errorf("mean = %v, want 5", r.mean)
+	}
+	if got := r.stdDev(); got < 1.99 || got > 2.01 {
+		t.Errorf("stdDev = %v, want ~2", got)
+	}
+}
+
+func TestExactQuantileFunc(t *testing.T) {
+	q := exactQuantileFunc([]uint64{10, 20, 30, 40})
+
+	if got := q(0); got != 10 {
+		t.Errorf("p0 = %v, want 10", got)
+	}
+	if got := q(1); got != 40 {
+		t.Errorf("p100 = %v, want 40", got)
+	}
+	if got := q(0.5); got < 19.9 || got > 25.1 {
+		t.Errorf("p50 = %v, want ~20-25", got)
+	}
+}
+
+func TestTDigestQuantile(t *testing.T) {
+	d := newTDigest(100)
+	for i := 1; i <= 1000; i++ {
+		d.Add(float64(i))
+	}
+
+	if got := d.Quantile(0.5); got < 490 || got > 510 {
+		t.Errorf("p50 = %v, want ~500", got)
+	}
+	if got := d.Quantile(0.99); got < 980 || got > 1000 {
+		t.Errorf("p99 = %v, want ~990-1000", got)
+	}
+}
+
+func TestSizeAggregatorDistribution(t *testing.T) {
+	agg := newSizeAggregator(2, true)
+	for key, size := range map[string]uint64{"a": 10, "b": 30, "c": 20} {
+		agg.observe(key, size)
+	}
+
+	dist := agg.distribution()
+
+	if dist.MinSize != 10 {
+		t.Errorf("MinSize = %d, want 10", dist.MinSize)
+	}
+	if len(dist.TopK) != 2 {
+		t.Fatalf("got %d top-k entries, want 2", len(dist.TopK))
+	}
+	if dist.TopK[0].SizeBytes != 30 {
+		t.Errorf("largest top-k entry size = %d, want 30", dist.TopK[0].SizeBytes)
+	}
+}
@@ -0,0 +1,442 @@
+package tools
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+	"google.golang.org/protobuf/proto"
+)
+
+// Exporter writes a stream of StoreStats out to some destination. It is
+// the composition of a destination (stdout, a single file, a tar stream,
+// a dstore.Store) and a record format (json, csv, tsv, ndjson, proto),
+// modeled after docker buildx's `--output=type=...,key=value` exporters.
+type Exporter interface {
+	Open(ctx context.Context) error
+	WriteHeader() error
+	WriteModule(stats *StoreStats) error
+	Close() error
+}
+
+// outputSpec is the parsed form of the --output flag.
+type outputSpec struct {
+	Type   string // stdout, file, tar, dstore
+	Format string // json, csv, tsv, ndjson, proto
+	Dest   string
+}
+
+func parseOutputSpec(raw string) (*outputSpec, error) {
+	spec := &outputSpec{Type: "stdout", Format: "json"}
+	switch {
+	case raw == "", raw == "-":
+		return spec, nil
+	case !strings.Contains(raw, "="):
+		// bare format shorthand, e.g. --output=ndjson
+		spec.Format = raw
+		return spec, nil
+	}
+
+	var typeExplicit bool
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid --output attribute %q, expected key=value", pair)
+		}
+		switch kv[0] {
+		case "type":
+			spec.Type = kv[1]
+			typeExplicit = true
+		case "format":
+			spec.Format = kv[1]
+		case "dest":
+			spec.Dest = kv[1]
+		default:
+			return nil, fmt.Errorf("unknown --output attribute %q", kv[0])
+		}
+	}
+
+	// Only default to stdout on an explicit "dest=-" when the caller
+	// didn't also name a type; tarExporter/dstoreExporter etc. know how
+	// to treat "-"/"" as stdout themselves, so an explicit type=tar or
+	// type=dstore must be preserved.
+	if !typeExplicit && spec.Dest == "-" {
+		spec.Type = "stdout"
+	}
+
+	return spec, nil
+}
+
+func newExporter(spec *outputSpec) (Exporter, error) {
+	enc, err := newRecordEncoder(spec.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch spec.Type {
+	case "stdout":
+		return &streamExporter{out: os.Stdout, enc: enc}, nil
+	case "file":
+		if spec.Dest == "" {
+			return nil, fmt.Errorf("--output type=file requires a 'dest' attribute")
+		}
+		return &fileExporter{path: spec.Dest, enc: enc}, nil
+	case "tar":
+		return &tarExporter{dest: spec.Dest, enc: enc}, nil
+	case "dstore":
+		if spec.Dest == "" {
+			return nil, fmt.Errorf("--output type=dstore requires a 'dest' attribute")
+		}
+		return &dstoreExporter{dest: spec.Dest, enc: enc}, nil
+	default:
+		return nil, fmt.Errorf("unknown --output type %q, expected one of: stdout, file, tar, dstore", spec.Type)
+	}
+}
+
+// recordEncoder renders one StoreStats document. writeRecord is called
+// once per module, between a single writeHeader/writeFooter pair; index
+// is the zero-based position of the record within that pair, so an
+// encoder can tell a document's first record from the rest.
+type recordEncoder interface {
+	extension() string
+	writeHeader(w io.Writer) error
+	writeRecord(w io.Writer, index int, stats *StoreStats) error
+	writeFooter(w io.Writer) error
+}
+
+func newRecordEncoder(format string) (recordEncoder, error) {
+	switch format {
+	case "", "json":
+		return &jsonEncoder{}, nil
+	case "ndjson":
+		return &ndjsonEncoder{}, nil
+	case "csv":
+		return &delimitedEncoder{comma: ',', ext: "csv"}, nil
+	case "tsv":
+		return &delimitedEncoder{comma: '\t', ext: "tsv"}, nil
+	case "proto":
+		return &protoEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown --output format %q, expected one of: json, csv, tsv, ndjson, proto", format)
+	}
+}
+
+// streamExporter writes every module into a single shared writer,
+// sharing one header/footer pair across the whole run.
+type streamExporter struct {
+	out    io.Writer
+	enc    recordEncoder
+	closer io.Closer
+	count  int
+}
+
+func (e *streamExporter) Open(context.Context) error { return nil }
+
+func (e *streamExporter) WriteHeader() error {
+	return e.enc.writeHeader(e.out)
+}
+
+func (e *streamExporter) WriteModule(stats *StoreStats) error {
+	if err := e.enc.writeRecord(e.out, e.count, stats); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+func (e *streamExporter) Close() error {
+	if err := e.enc.writeFooter(e.out); err != nil {
+		return err
+	}
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// fileExporter is a streamExporter backed by a single destination file.
+type fileExporter struct {
+	path string
+	enc  recordEncoder
+	streamExporter
+}
+
+func (e *fileExporter) Open(ctx context.Context) error {
+	f, err := os.Create(e.path)
+	if err != nil {
+		return fmt.Errorf("creating output file %q: %w", e.path, err)
+	}
+	e.streamExporter = streamExporter{out: f, enc: e.enc, closer: f}
+	return nil
+}
+
+// tarExporter streams one complete record per module as its own entry
+// in a tar archive, named by module hash. Order is irrelevant since each
+// module is self-contained.
+type tarExporter struct {
+	dest string
+	enc  recordEncoder
+	out  io.WriteCloser
+	tw   *tar.Writer
+}
+
+func (e *tarExporter) Open(context.Context) error {
+	if e.dest == "" || e.dest == "-" {
+		e.out = stdoutNopCloser{}
+	} else {
+		f, err := os.Create(e.dest)
+		if err != nil {
+			return fmt.Errorf("creating tar output %q: %w", e.dest, err)
+		}
+		e.out = f
+	}
+	e.tw = tar.NewWriter(e.out)
+	return nil
+}
+
+func (e *tarExporter) WriteHeader() error { return nil }
+
+func (e *tarExporter) WriteModule(stats *StoreStats) error {
+	buf, err := encodeSingleRecord(e.enc, stats)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%s", stats.ModuleHash, e.enc.extension())
+	if err := e.tw.WriteHeader(&tar.Header{
+		Name: name,
+		Mode: 0o644,
+		Size: int64(buf.Len()),
+	}); err != nil {
+		return fmt.Errorf("writing tar header for %q: %w", name, err)
+	}
+	if _, err := e.tw.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("writing tar entry for %q: %w", name, err)
+	}
+	return nil
+}
+
+func (e *tarExporter) Close() error {
+	if err := e.tw.Close(); err != nil {
+		return fmt.Errorf("closing tar writer: %w", err)
+	}
+	return e.out.Close()
+}
+
+// dstoreExporter writes one object per module hash into a dstore.Store,
+// so results can land directly in object storage (gs://, s3://, ...).
+type dstoreExporter struct {
+	dest  string
+	enc   recordEncoder
+	store dstore.Store
+	ctx   context.Context
+}
+
+func (e *dstoreExporter) Open(ctx context.Context) error {
+	store, err := dstore.NewStore(e.dest, "", "", false)
+	if err != nil {
+		return fmt.Errorf("creating destination store %q: %w", e.dest, err)
+	}
+	e.store = store
+	e.ctx = ctx
+	return nil
+}
+
+func (e *dstoreExporter) WriteHeader() error { return nil }
+
+func (e *dstoreExporter) WriteModule(stats *StoreStats) error {
+	buf, err := encodeSingleRecord(e.enc, stats)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%s", stats.ModuleHash, e.enc.extension())
+	if err := e.store.WriteObject(e.ctx, name, buf); err != nil {
+		return fmt.Errorf("writing object %q: %w", name, err)
+	}
+	return nil
+}
+
+func (e *dstoreExporter) Close() error { return nil }
+
+func encodeSingleRecord(enc recordEncoder, stats *StoreStats) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := enc.writeHeader(buf); err != nil {
+		return nil, err
+	}
+	if err := enc.writeRecord(buf, 0, stats); err != nil {
+		return nil, err
+	}
+	if err := enc.writeFooter(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// stdoutNopCloser wraps os.Stdout for use as an io.WriteCloser whose
+// Close is a no-op, so tarExporter.Close can close its output without
+// closing the process's stdout.
+type stdoutNopCloser struct{}
+
+func (stdoutNopCloser) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdoutNopCloser) Close() error                { return nil }
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) extension() string { return "json" }
+
+func (jsonEncoder) writeHeader(w io.Writer) error {
+	_, err := io.WriteString(w, "[\n")
+	return err
+}
+
+func (jsonEncoder) writeRecord(w io.Writer, index int, stats *StoreStats) error {
+	if index > 0 {
+		if _, err := io.WriteString(w, ",\n"); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(stats, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling stats to json: %w", err)
+	}
+	if _, err := io.WriteString(w, "  "); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (jsonEncoder) writeFooter(w io.Writer) error {
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) extension() string { return "ndjson" }
+
+func (ndjsonEncoder) writeHeader(io.Writer) error { return nil }
+
+func (ndjsonEncoder) writeRecord(w io.Writer, _ int, stats *StoreStats) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("marshaling stats to json: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func (ndjsonEncoder) writeFooter(io.Writer) error { return nil }
+
+// delimitedColumns lists only the scalar aggregates; a flat row has no
+// good way to carry a histogram or a top-K list, so those only show up
+// in the json/ndjson/proto formats.
+var delimitedColumns = []string{
+	"module_name", "module_hash", "module_initial_block", "module_value_type", "module_update_policy",
+	"count",
+	"keys_total_size_bytes", "keys_average_size_bytes", "keys_std_dev_size_bytes", "keys_min_size_bytes", "keys_p50_size_bytes", "keys_p99_size_bytes",
+	"values_total_size_bytes", "values_average_size_bytes", "values_std_dev_size_bytes", "values_min_size_bytes", "values_p50_size_bytes", "values_p99_size_bytes",
+}
+
+// delimitedEncoder renders one flat row per module, as csv (comma=',')
+// or tsv (comma='\t').
+type delimitedEncoder struct {
+	comma rune
+	ext   string
+}
+
+func (e *delimitedEncoder) extension() string { return e.ext }
+
+func (e *delimitedEncoder) writeHeader(w io.Writer) error {
+	return e.writeRow(w, delimitedColumns)
+}
+
+func (e *delimitedEncoder) writeRecord(w io.Writer, _ int, stats *StoreStats) error {
+	row := []string{
+		stats.Name,
+		stats.ModuleHash,
+		strconv.FormatUint(stats.InitialBlock, 10),
+		stats.ValueType,
+		stats.UpdatePolicy,
+		strconv.FormatUint(stats.KeysCount, 10),
+	}
+
+	if stats.KeyStats != nil {
+		row = append(row, delimitedScalarColumns(stats.KeyStats.TotalSize, stats.KeyStats.AverageSize, stats.KeyStats.StdDevSize, stats.KeyStats.Distribution)...)
+	} else {
+		row = append(row, "", "", "", "", "", "")
+	}
+
+	if stats.ValueStats != nil {
+		row = append(row, delimitedScalarColumns(stats.ValueStats.TotalSize, stats.ValueStats.AverageSize, stats.ValueStats.StdDevSize, stats.ValueStats.Distribution)...)
+	} else {
+		row = append(row, "", "", "", "", "", "")
+	}
+
+	return e.writeRow(w, row)
+}
+
+func delimitedScalarColumns(totalSize uint64, averageSize, stdDevSize float64, dist *Distribution) []string {
+	columns := []string{
+		strconv.FormatUint(totalSize, 10),
+		strconv.FormatFloat(averageSize, 'f', -1, 64),
+		strconv.FormatFloat(stdDevSize, 'f', -1, 64),
+	}
+	if dist == nil {
+		return append(columns, "", "", "")
+	}
+	return append(columns,
+		strconv.FormatUint(dist.MinSize, 10),
+		strconv.FormatFloat(dist.P50, 'f', -1, 64),
+		strconv.FormatFloat(dist.P99, 'f', -1, 64),
+	)
+}
+
+func (e *delimitedEncoder) writeFooter(io.Writer) error { return nil }
+
+func (e *delimitedEncoder) writeRow(w io.Writer, row []string) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = e.comma
+	if err := cw.Write(row); err != nil {
+		return fmt.Errorf("writing row: %w", err)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// protoEncoder writes each module as a length-prefixed
+// analytics.v1.StoreStats message, so a single destination can hold
+// several modules back to back without ambiguity about message
+// boundaries.
+type protoEncoder struct{}
+
+func (protoEncoder) extension() string { return "pb" }
+
+func (protoEncoder) writeHeader(io.Writer) error { return nil }
+
+func (protoEncoder) writeRecord(w io.Writer, _ int, stats *StoreStats) error {
+	data, err := proto.Marshal(stats.toProto())
+	if err != nil {
+		return fmt.Errorf("marshaling stats to proto: %w", err)
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+	if _, err := w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (protoEncoder) writeFooter(io.Writer) error { return nil }
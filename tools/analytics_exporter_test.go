@@ -0,0 +1,76 @@
+package tools
+
+import "testing"
+
+func TestParseOutputSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    outputSpec
+		wantErr bool
+	}{
+		{
+			name: "empty defaults to stdout json",
+			raw:  "",
+			want: outputSpec{Type: "stdout", Format: "json"},
+		},
+		{
+			name: "bare dash is shorthand for the default",
+			raw:  "-",
+			want: outputSpec{Type: "stdout", Format: "json"},
+		},
+		{
+			name: "bare format shorthand",
+			raw:  "ndjson",
+			want: outputSpec{Type: "stdout", Format: "ndjson"},
+		},
+		{
+			name: "type and dest attributes",
+			raw:  "type=file,dest=./stats.json",
+			want: outputSpec{Type: "file", Format: "json", Dest: "./stats.json"},
+		},
+		{
+			name: "type, format and dest attributes",
+			raw:  "type=dstore,format=proto,dest=gs://bucket/stats",
+			want: outputSpec{Type: "dstore", Format: "proto", Dest: "gs://bucket/stats"},
+		},
+		{
+			name: "dest=- with no explicit type defaults to stdout",
+			raw:  "dest=-",
+			want: outputSpec{Type: "stdout", Format: "json", Dest: "-"},
+		},
+		{
+			name: "explicit type is preserved even when dest=-",
+			raw:  "type=tar,dest=-",
+			want: outputSpec{Type: "tar", Format: "json", Dest: "-"},
+		},
+		{
+			name:    "malformed attribute",
+			raw:     "type=file,dest",
+			wantErr: true,
+		},
+		{
+			name:    "unknown attribute",
+			raw:     "bogus=1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutputSpec(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
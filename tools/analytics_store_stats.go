@@ -3,10 +3,8 @@ package tools
 import (
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"sort"
 	"sync"
 	"time"
@@ -17,6 +15,7 @@ import (
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/substreams/block"
 	"github.com/streamingfast/substreams/manifest"
+	pbanalytics "github.com/streamingfast/substreams/pb/sf/substreams/analytics/v1"
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 	"go.uber.org/zap"
 )
@@ -29,6 +28,10 @@ var analyticsStoreStatsCmd = &cobra.Command{
 }
 
 func init() {
+	analyticsStoreStatsCmd.Flags().String("output", "json", "Output destination and format, as comma-separated key=value attributes (e.g. 'type=file,dest=./stats.json', 'type=tar,dest=-', 'type=dstore,dest=gs://bucket/stats'); bare 'json', 'csv', 'tsv', 'ndjson' or 'proto' write that format to stdout, and '-' is shorthand for the default")
+	analyticsStoreStatsCmd.Flags().String("selector", "", "Only compute stats for modules whose labels match this selector, e.g. 'team=defi,chain=eth'")
+	analyticsStoreStatsCmd.Flags().Int("top-k", 10, "Number of largest keys/values to report in each store's distribution")
+	analyticsStoreStatsCmd.Flags().Bool("exact-quantiles", false, "Compute exact percentiles instead of approximating them with a t-digest sketch; holds every key/value length in memory")
 	analyticsCmd.AddCommand(analyticsStoreStatsCmd)
 }
 
@@ -40,6 +43,19 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 	manifestPath := args[0]
 	storePath := args[1]
 
+	outputFlag, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("reading output flag: %w", err)
+	}
+	outputSpec, err := parseOutputSpec(outputFlag)
+	if err != nil {
+		return fmt.Errorf("parsing --output: %w", err)
+	}
+	exporter, err := newExporter(outputSpec)
+	if err != nil {
+		return fmt.Errorf("creating exporter: %w", err)
+	}
+
 	baseDStore, err := dstore.NewStore(storePath, "", "", false)
 	if err != nil {
 		return fmt.Errorf("creating base store: %w", err)
@@ -56,10 +72,47 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("creating module graph: %w", err)
 	}
 
+	selectorFlag, err := cmd.Flags().GetString("selector")
+	if err != nil {
+		return fmt.Errorf("reading selector flag: %w", err)
+	}
+	selector, err := manifest.ParseSelector(selectorFlag)
+	if err != nil {
+		return fmt.Errorf("parsing --selector: %w", err)
+	}
+
+	topK, err := cmd.Flags().GetInt("top-k")
+	if err != nil {
+		return fmt.Errorf("reading top-k flag: %w", err)
+	}
+	exactQuantiles, err := cmd.Flags().GetBool("exact-quantiles")
+	if err != nil {
+		return fmt.Errorf("reading exact-quantiles flag: %w", err)
+	}
+
+	selectedModules := pkg.Modules.Modules
+	if selector != nil {
+		selected, err := graph.SelectByLabels(selector)
+		if err != nil {
+			return fmt.Errorf("selecting modules: %w", err)
+		}
+
+		selectedNames := make(map[string]bool, len(selected))
+		for _, module := range selected {
+			selectedNames[module.Name] = true
+		}
+
+		selectedModules = nil
+		for _, module := range pkg.Modules.Modules {
+			if selectedNames[module.Name] {
+				selectedModules = append(selectedModules, module)
+			}
+		}
+	}
+
 	wg := sync.WaitGroup{}
-	wg.Add(len(pkg.Modules.Modules))
+	wg.Add(len(selectedModules))
 
-	stats := make([]*StoreStats, 0, len(pkg.Modules.Modules))
 	statsStream := make(chan *StoreStats)
 
 	go func() {
@@ -70,7 +123,7 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 	}()
 
 	hashes := manifest.NewModuleHashes()
-	for _, module := range pkg.Modules.Modules {
+	for _, module := range selectedModules {
 		go func(module *pbsubstreams.Module) {
 			start := time.Now()
 			defer func() {
@@ -121,7 +174,7 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 				FileSize:       fileSize,
 			}
 
-			err = calculateStoreStats(stateStore, storeStats)
+			err = calculateStoreStats(stateStore, storeStats, topK, exactQuantiles)
 			if err != nil {
 				zlog.Error("getting store stats", zap.Error(err))
 				return
@@ -132,11 +185,18 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 		}(module)
 	}
 
+	stats := make([]*StoreStats, 0, len(selectedModules))
 	for stat := range statsStream {
 		stats = append(stats, stat)
 	}
 
-	//sort the modules for consistent output
+	// Sort the (small, one-per-store-module) results for output that's
+	// stable run to run, e.g. for `--output=csv` piped into a diff tool
+	// or golden-file tests; BuildCommitInfo sorts its StoreInfos by name
+	// for the same reason. This buffers at most one *StoreStats per
+	// store module, not per key/value, so it doesn't reintroduce the
+	// per-key memory growth the size-distribution sketches were added
+	// to avoid.
 	sortedModules, _ := graph.TopologicalSort()
 	sortedModulesIndex := make(map[string]int, len(sortedModules))
 	for i, module := range sortedModules {
@@ -146,13 +206,18 @@ func StoreStatsE(cmd *cobra.Command, args []string) error {
 		return sortedModulesIndex[stats[i].Name] > sortedModulesIndex[stats[j].Name]
 	})
 
-	data, err := json.MarshalIndent(stats, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshaling stats to json: %w", err)
+	if err := exporter.Open(ctx); err != nil {
+		return fmt.Errorf("opening output: %w", err)
 	}
-
-	_, _ = fmt.Fprintln(cmd.OutOrStdout(), string(data))
-	return nil
+	if err := exporter.WriteHeader(); err != nil {
+		return fmt.Errorf("writing output header: %w", err)
+	}
+	for _, stat := range stats {
+		if err := exporter.WriteModule(stat); err != nil {
+			return fmt.Errorf("writing module %q: %w", stat.Name, err)
+		}
+	}
+	return exporter.Close()
 }
 
 type StoreStats struct {
@@ -177,20 +242,63 @@ type FileInfo struct {
 
 type KeyStats struct {
 	TotalSize   uint64  `json:"total_size_bytes"`
-	LargestSize uint64  `json:"largest_size_bytes"`
 	AverageSize float64 `json:"average_size_bytes"`
 	StdDevSize  float64 `json:"std_dev_size_bytes"`
 
-	Largest string `json:"largest"`
+	Distribution *Distribution `json:"distribution,omitempty"`
 }
 
 type ValueStats struct {
 	TotalSize   uint64  `json:"total_size_bytes"`
-	LargestSize uint64  `json:"largest_size_bytes"`
 	AverageSize float64 `json:"average_size_bytes"`
 	StdDevSize  float64 `json:"std_dev_size_bytes"`
 
-	Largest string `json:"largest_value_key"`
+	Distribution *Distribution `json:"distribution,omitempty"`
+}
+
+// toProto converts to the wire representation used by the `proto`
+// output format, so downstream tooling can consume results without
+// re-parsing JSON.
+func (s *StoreStats) toProto() *pbanalytics.StoreStats {
+	pb := &pbanalytics.StoreStats{
+		ModuleName:         s.Name,
+		ModuleHash:         s.ModuleHash,
+		ModuleInitialBlock: s.InitialBlock,
+		ModuleValueType:    s.ValueType,
+		ModuleUpdatePolicy: s.UpdatePolicy,
+		Count:              s.KeysCount,
+	}
+
+	if s.FileInfo != nil {
+		pb.FileInfo = &pbanalytics.FileInfo{
+			Name:      s.FileInfo.FileName,
+			SizeBytes: s.FileInfo.FileSize,
+		}
+		if s.FileInfo.FileBlockRange != nil {
+			pb.FileInfo.StartBlock = s.FileInfo.FileBlockRange.StartBlock
+			pb.FileInfo.EndBlock = s.FileInfo.FileBlockRange.EndBlock
+		}
+	}
+
+	if s.KeyStats != nil {
+		pb.Keys = &pbanalytics.KeyStats{
+			TotalSizeBytes:   s.KeyStats.TotalSize,
+			AverageSizeBytes: s.KeyStats.AverageSize,
+			StdDevSizeBytes:  s.KeyStats.StdDevSize,
+			Distribution:     s.KeyStats.Distribution.toProto(),
+		}
+	}
+
+	if s.ValueStats != nil {
+		pb.Values = &pbanalytics.ValueStats{
+			TotalSizeBytes:   s.ValueStats.TotalSize,
+			AverageSizeBytes: s.ValueStats.AverageSize,
+			StdDevSizeBytes:  s.ValueStats.StdDevSize,
+			Distribution:     s.ValueStats.Distribution.toProto(),
+		}
+	}
+
+	return pb
 }
 
 func initializeStoreStats(conf *store2.Config) *StoreStats {
@@ -237,32 +345,30 @@ func getStore(ctx context.Context, conf *store2.Config) (store2.Store, *store2.F
 	return s, latestFile, nil
 }
 
-func calculateStoreStats(stateStore store2.Store, stats *StoreStats) error {
-	keyStats := &KeyStats{}
-	valueStats := &ValueStats{}
-	stats.KeyStats = keyStats
-	stats.ValueStats = valueStats
+// calculateStoreStats summarizes a store's key and value sizes. Rather
+// than buffering every length seen (a real memory problem for stores
+// with tens of millions of keys), it folds each key/value into a
+// sizeAggregator that keeps O(topK + digest compression) state
+// regardless of how many entries the store holds. With exactQuantiles
+// set, every key and value size is kept in memory as well.
+func calculateStoreStats(stateStore store2.Store, stats *StoreStats, topK int, exactQuantiles bool) error {
+	stats.KeyStats = &KeyStats{}
+	stats.ValueStats = &ValueStats{}
 
-	keyLens := make([]float64, 0, 1000)
-	valueLens := make([]float64, 0, 1000)
+	keyAgg := newSizeAggregator(topK, exactQuantiles)
+	valueAgg := newSizeAggregator(topK, exactQuantiles)
 
 	err := stateStore.Iter(func(key string, value []byte) error {
 		stats.KeysCount++
-		stats.ValueStats.TotalSize += uint64(len(value))
-		stats.KeyStats.TotalSize += uint64(len(key))
 
-		keyLens = append(keyLens, float64(len(key)))
-		valueLens = append(valueLens, float64(len(value)))
+		keySize := uint64(len(key))
+		valueSize := uint64(len(value))
 
-		if uint64(len(key)) > stats.KeyStats.LargestSize {
-			stats.KeyStats.LargestSize = uint64(len(key))
-			stats.KeyStats.Largest = key
-		}
+		stats.KeyStats.TotalSize += keySize
+		stats.ValueStats.TotalSize += valueSize
 
-		if uint64(len(value)) > stats.ValueStats.LargestSize {
-			stats.ValueStats.LargestSize = uint64(len(value))
-			stats.ValueStats.Largest = key
-		}
+		keyAgg.observe(key, keySize)
+		valueAgg.observe(key, valueSize)
 
 		return nil
 	})
@@ -270,29 +376,19 @@ func calculateStoreStats(stateStore store2.Store, stats *StoreStats) error {
 		return fmt.Errorf("iterating store: %w", err)
 	}
 
-	if stats.KeysCount > 0 {
-		meanKeyLen := float64(stats.KeyStats.TotalSize) / float64(stats.KeysCount)
-		keyLenStdDev := stdDev(keyLens, meanKeyLen)
-		stats.KeyStats.StdDevSize = keyLenStdDev
-
-		meanValueLen := float64(stats.ValueStats.TotalSize) / float64(stats.KeysCount)
-		valueLenStdDev := stdDev(valueLens, meanValueLen)
-		stats.ValueStats.StdDevSize = valueLenStdDev
-
-		stats.KeyStats.AverageSize = meanKeyLen
-		stats.ValueStats.AverageSize = meanValueLen
-	} else {
+	if stats.KeysCount == 0 {
 		stats.KeyStats = nil
 		stats.ValueStats = nil
+		return nil
 	}
 
-	return nil
-}
+	stats.KeyStats.AverageSize = keyAgg.running.mean
+	stats.KeyStats.StdDevSize = keyAgg.running.stdDev()
+	stats.KeyStats.Distribution = keyAgg.distribution()
 
-func stdDev(xs []float64, mean float64) float64 {
-	var sum float64
-	for _, x := range xs {
-		sum += math.Pow(x-mean, 2)
-	}
-	return math.Sqrt(sum / float64(len(xs)))
+	stats.ValueStats.AverageSize = valueAgg.running.mean
+	stats.ValueStats.StdDevSize = valueAgg.running.stdDev()
+	stats.ValueStats.Distribution = valueAgg.distribution()
+
+	return nil
 }